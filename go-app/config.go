@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Config bundles everything NewApp needs to reach MongoDB: where it
+// lives, which database to use, where to read credentials from, and how
+// long to wait on it. Production wiring (main) and the testcontainers
+// integration suite both build an App from a Config, so they share the
+// exact same connection/rotation code path.
+type Config struct {
+	// Host is the MongoDB endpoint, e.g. "host:27017". In production
+	// this is the Helm-chart-internal service DNS name; tests point it
+	// at a testcontainers-managed instance.
+	Host string
+	// DBName is the database to operate against.
+	DBName string
+	// SecretsPath is where the Vault-injected credentials file (or, in
+	// X.509 mode, the directory convention used by NewX509CredentialSource)
+	// lives. Configurable so tests can inject a fake file from a temp dir.
+	SecretsPath string
+	// AuthMode selects username/password vs. X.509 client-cert auth.
+	AuthMode AuthMode
+	// CredentialSource selects which CredentialSource implementation
+	// supplies username/password creds when AuthMode is AuthModePassword.
+	// Ignored in X.509 mode, which always uses NewX509CredentialSource.
+	CredentialSource CredentialSourceKind
+
+	// VaultAddr, VaultDBMount, VaultDBRole, and VaultK8sTokenPath
+	// configure VaultAPICredentialSource; only used when CredentialSource
+	// is CredentialSourceVaultAPI.
+	VaultAddr         string
+	VaultDBMount      string
+	VaultDBRole       string
+	VaultK8sTokenPath string
+
+	// JWTSigningKey is the statically configured JWT signing key,
+	// always read from JWT_SIGNING_KEY regardless of AuthMode or
+	// CredentialSource. It's the only way to supply a key for the X.509
+	// and Vault API credential sources, whose Credentials never carry a
+	// SigningKey; for the file/env sources it's a fallback used only
+	// until the first credentials read populates one.
+	JWTSigningKey string
+
+	ConnectTimeout time.Duration
+	PingTimeout    time.Duration
+}
+
+// CredentialSourceKind selects which CredentialSource implementation
+// NewApp wires up for username/password auth.
+type CredentialSourceKind string
+
+const (
+	CredentialSourceFile     CredentialSourceKind = "file"
+	CredentialSourceEnv      CredentialSourceKind = "env"
+	CredentialSourceVaultAPI CredentialSourceKind = "vault-api"
+)
+
+// DefaultConfig returns the production configuration used by main,
+// reading overrides from the environment the same way the app always
+// has.
+func DefaultConfig() Config {
+	return Config{
+		Host:              mongoHost,
+		DBName:            "appdb",
+		SecretsPath:       envOr("MONGO_SECRETS_PATH", defaultSecretsPath),
+		AuthMode:          AuthMode(envOr("MONGO_AUTH_MODE", string(AuthModePassword))),
+		CredentialSource:  CredentialSourceKind(envOr("MONGO_CREDENTIAL_SOURCE", string(CredentialSourceFile))),
+		VaultAddr:         os.Getenv("VAULT_ADDR"),
+		VaultDBMount:      envOr("VAULT_DB_MOUNT_PATH", "database"),
+		VaultDBRole:       os.Getenv("VAULT_DB_ROLE"),
+		VaultK8sTokenPath: os.Getenv("VAULT_K8S_TOKEN_PATH"),
+		JWTSigningKey:     os.Getenv("JWT_SIGNING_KEY"),
+		ConnectTimeout:    10 * time.Second,
+		PingTimeout:       10 * time.Second,
+	}
+}
+
+// mongoURI builds the connection string for the given credentials,
+// branching on auth mode the same way regardless of whether Host/DBName
+// point at the in-cluster Helm service or a local test container.
+func (c Config) mongoURI(creds Credentials) string {
+	if creds.AuthMode == AuthModeX509 {
+		return fmt.Sprintf("mongodb://%s/%s?authMechanism=MONGODB-X509&tls=true", c.Host, c.DBName)
+	}
+	// Vault's dynamic database secrets engine mints usernames/passwords
+	// that can contain URL-reserved characters, so these must be escaped
+	// rather than interpolated raw.
+	userinfo := url.UserPassword(creds.User, creds.Password)
+	return fmt.Sprintf("mongodb://%s@%s/%s", userinfo.String(), c.Host, c.DBName)
+}
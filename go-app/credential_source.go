@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// AuthMode selects how the App authenticates to MongoDB.
+type AuthMode string
+
+const (
+	// AuthModePassword authenticates with a SCRAM username/password pair.
+	AuthModePassword AuthMode = "password"
+	// AuthModeX509 authenticates with a Vault PKI-issued client
+	// certificate using the MONGODB-X509 mechanism.
+	AuthModeX509 AuthMode = "x509"
+)
+
+// Credentials holds whatever MongoDB needs to authenticate a connection,
+// as resolved from whichever CredentialSource produced them. Only the
+// fields relevant to AuthMode are populated.
+type Credentials struct {
+	AuthMode AuthMode
+
+	User     string
+	Password string
+
+	TLSConfig *tls.Config
+
+	// SigningKey is the JWT signing key, when present in the secrets
+	// file (export JWT_SIGNING_KEY=...). Populated alongside the Mongo
+	// credentials so key rotation rides the same watcher/reload path as
+	// password/cert rotation.
+	SigningKey string
+
+	// Fingerprint identifies the current credential material so callers
+	// can detect rotation without comparing TLSConfig, which isn't
+	// comparable with ==.
+	Fingerprint string
+
+	// LeaseID identifies the Vault lease backing these credentials, when
+	// sourced from VaultAPICredentialSource. Lets a superseded credential
+	// be explicitly revoked rather than left for Vault to expire on its
+	// own schedule.
+	LeaseID string
+
+	// LeaseDuration is how long the Vault lease backing these
+	// credentials is valid for. Populated by VaultAPICredentialSource so
+	// the watcher can poll on the lease's actual TTL instead of a fixed
+	// interval.
+	LeaseDuration time.Duration
+}
+
+// CredentialSource abstracts the origin of MongoDB credentials so the
+// connection/rotation logic doesn't need to know whether they came from
+// a Vault-injected file, plain environment variables, or a direct call
+// to the Vault API.
+type CredentialSource interface {
+	Read() (Credentials, error)
+}
+
+// FileCredentialSource reads credentials from a Vault agent injected
+// secrets file of the form:
+//
+//	export MONGO_USER="..."
+//	export MONGO_PASSWORD="..."
+type FileCredentialSource struct {
+	Path string
+}
+
+func (f FileCredentialSource) Read() (Credentials, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer file.Close()
+
+	var creds Credentials
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "export MONGO_USER=") {
+			creds.User = strings.Trim(strings.TrimPrefix(line, "export MONGO_USER="), `"`)
+		} else if strings.HasPrefix(line, "export MONGO_PASSWORD=") {
+			creds.Password = strings.Trim(strings.TrimPrefix(line, "export MONGO_PASSWORD="), `"`)
+		} else if strings.HasPrefix(line, "export JWT_SIGNING_KEY=") {
+			creds.SigningKey = strings.Trim(strings.TrimPrefix(line, "export JWT_SIGNING_KEY="), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, err
+	}
+
+	if creds.User == "" || creds.Password == "" {
+		return Credentials{}, fmt.Errorf("MongoDB credentials not found in %s", f.Path)
+	}
+	creds.AuthMode = AuthModePassword
+	creds.Fingerprint = creds.User + ":" + creds.Password + ":" + creds.SigningKey
+	return creds, nil
+}
+
+// EnvCredentialSource reads credentials from MONGO_USER/MONGO_PASSWORD
+// environment variables. This is the fallback used outside of Kubernetes
+// pods that have the Vault agent sidecar.
+type EnvCredentialSource struct{}
+
+func (EnvCredentialSource) Read() (Credentials, error) {
+	user := os.Getenv("MONGO_USER")
+	password := os.Getenv("MONGO_PASSWORD")
+	signingKey := os.Getenv("JWT_SIGNING_KEY")
+	if user == "" || password == "" {
+		return Credentials{}, fmt.Errorf("MongoDB credentials not found in environment variables")
+	}
+	return Credentials{
+		AuthMode:    AuthModePassword,
+		User:        user,
+		Password:    password,
+		SigningKey:  signingKey,
+		Fingerprint: user + ":" + password + ":" + signingKey,
+	}, nil
+}
+
+// VaultAPICredentialSource fetches dynamic database credentials directly
+// from Vault's HTTP API using the Kubernetes service account token for
+// approle/kubernetes auth, bypassing the agent sidecar entirely. This is
+// useful for operators that want tighter control over lease renewal than
+// the agent's templated file provides.
+type VaultAPICredentialSource struct {
+	Addr       string // e.g. https://vault.vault.svc.cluster.local:8200
+	MountPath  string // e.g. database
+	RoleName   string // e.g. mongo-app
+	TokenPath  string // defaults to /var/run/secrets/kubernetes.io/serviceaccount/token
+	HTTPClient *http.Client
+}
+
+func (v VaultAPICredentialSource) Read() (Credentials, error) {
+	tokenPath := v.TokenPath
+	if tokenPath == "" {
+		tokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+
+	vaultToken, err := v.loginKubernetes(tokenPath)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("vault kubernetes login: %w", err)
+	}
+
+	client := v.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/creds/%s", v.Addr, v.MountPath, v.RoleName)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("X-Vault-Token", vaultToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("vault returned status %d reading dynamic creds", resp.StatusCode)
+	}
+
+	var payload struct {
+		LeaseID       string `json:"lease_id"`
+		LeaseDuration int    `json:"lease_duration"`
+		Data          struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return Credentials{}, fmt.Errorf("decode vault response: %w", err)
+	}
+
+	if payload.Data.Username == "" || payload.Data.Password == "" {
+		return Credentials{}, fmt.Errorf("vault response did not contain dynamic credentials")
+	}
+
+	return Credentials{
+		AuthMode:      AuthModePassword,
+		User:          payload.Data.Username,
+		Password:      payload.Data.Password,
+		Fingerprint:   payload.Data.Username + ":" + payload.Data.Password,
+		LeaseID:       payload.LeaseID,
+		LeaseDuration: time.Duration(payload.LeaseDuration) * time.Second,
+	}, nil
+}
+
+// Revoke asks Vault to revoke leaseID immediately, so a superseded
+// dynamic credential is retired as soon as rotateCredentials has swapped
+// in its replacement instead of sitting live until its lease expires on
+// its own.
+func (v VaultAPICredentialSource) Revoke(leaseID string) error {
+	tokenPath := v.TokenPath
+	if tokenPath == "" {
+		tokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+
+	vaultToken, err := v.loginKubernetes(tokenPath)
+	if err != nil {
+		return fmt.Errorf("vault kubernetes login: %w", err)
+	}
+
+	client := v.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	body, err := json.Marshal(map[string]string{"lease_id": leaseID})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, v.Addr+"/v1/sys/leases/revoke", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", vaultToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault returned status %d revoking lease", resp.StatusCode)
+	}
+	return nil
+}
+
+func (v VaultAPICredentialSource) loginKubernetes(tokenPath string) (string, error) {
+	jwt, err := ioutil.ReadFile(tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("read service account token: %w", err)
+	}
+
+	client := v.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"role": v.RoleName,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.Addr+"/v1/auth/kubernetes/login", strings.NewReader(string(body)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault kubernetes auth returned status %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("decode vault auth response: %w", err)
+	}
+	if payload.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault auth response did not contain a client token")
+	}
+
+	return payload.Auth.ClientToken, nil
+}
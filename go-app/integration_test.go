@@ -0,0 +1,348 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+)
+
+// These tests spin up a real MongoDB via testcontainers and exercise the
+// HTTP handlers against it end to end. Run with:
+//
+//	go test -tags=integration ./...
+//
+// They're excluded from the default `go test ./...` run since they need
+// a Docker daemon available.
+
+const testMongoUser = "integration"
+const testMongoPassword = "integration-password"
+
+func newTestApp(t *testing.T, ctx context.Context) *App {
+	t.Helper()
+
+	container, err := mongodb.RunContainer(ctx,
+		mongodb.WithUsername(testMongoUser),
+		mongodb.WithPassword(testMongoPassword),
+	)
+	if err != nil {
+		t.Fatalf("failed to start mongodb container: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Logf("failed to terminate mongodb container: %v", err)
+		}
+	})
+
+	connStr, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("failed to get mongodb connection string: %v", err)
+	}
+	host := strings.TrimPrefix(connStr, "mongodb://")
+
+	secretsDir := t.TempDir()
+	secretsPath := filepath.Join(secretsDir, "mongo")
+	secretsContents := fmt.Sprintf("export MONGO_USER=%q\nexport MONGO_PASSWORD=%q\n", testMongoUser, testMongoPassword)
+	if err := os.WriteFile(secretsPath, []byte(secretsContents), 0o600); err != nil {
+		t.Fatalf("failed to write fake vault secrets file: %v", err)
+	}
+
+	cfg := Config{
+		Host:           host,
+		DBName:         "appdb_integration",
+		SecretsPath:    secretsPath,
+		AuthMode:       AuthModePassword,
+		ConnectTimeout: 10 * time.Second,
+		PingTimeout:    10 * time.Second,
+	}
+
+	app := NewApp(cfg)
+	if err := app.connectToMongoDB(); err != nil {
+		t.Fatalf("failed to connect to test mongodb: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = app.client.Disconnect(ctx)
+	})
+
+	if err := app.ensureIndexes(); err != nil {
+		t.Fatalf("failed to ensure user indexes: %v", err)
+	}
+
+	app.sessionManager = NewSessionManager(app, []byte("test-signing-key"))
+	if err := app.sessionManager.ensureIndexes(); err != nil {
+		t.Fatalf("failed to ensure session indexes: %v", err)
+	}
+
+	return app
+}
+
+// authedRequest builds a request with body (if non-empty) and, if token
+// is non-empty, an Authorization: Bearer header — the same shape the
+// real router hands handlers, just without going through mux.
+func authedRequest(method, target, body, token string) *http.Request {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// loginAs logs in with identifier/password and returns the issued
+// session token, failing the test if login doesn't succeed.
+func loginAs(t *testing.T, app *App, identifier, password string) string {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"identifier":%q,"password":%q}`, identifier, password)
+	rec := httptest.NewRecorder()
+	app.login(rec, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login as %q: expected 200, got %d (%s)", identifier, rec.Code, rec.Body.String())
+	}
+
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode login response: %v", err)
+	}
+	if resp["token"] == "" {
+		t.Fatalf("expected login response to contain a token")
+	}
+	return resp["token"]
+}
+
+func TestCreateAndListUsers(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t, ctx)
+
+	body := strings.NewReader(`{"name":"Ada Lovelace","email":"ada@example.com","age":36}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/users", body)
+	rec := httptest.NewRecorder()
+	app.createUser(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("createUser: expected 201, got %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	var created User
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("decode createUser response: %v", err)
+	}
+	if created.ID.IsZero() {
+		t.Fatalf("expected createUser to assign an ID")
+	}
+
+	listReq := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	listRec := httptest.NewRecorder()
+	app.getUsers(listRec, listReq)
+
+	if listRec.Code != http.StatusOK {
+		t.Fatalf("getUsers: expected 200, got %d", listRec.Code)
+	}
+
+	var users []User
+	if err := json.NewDecoder(listRec.Body).Decode(&users); err != nil {
+		t.Fatalf("decode getUsers response: %v", err)
+	}
+	if len(users) != 1 || users[0].Email != "ada@example.com" {
+		t.Fatalf("expected one user with email ada@example.com, got %+v", users)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t, ctx)
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	rec := httptest.NewRecorder()
+	app.healthCheck(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("healthCheck: expected 200, got %d", rec.Code)
+	}
+
+	var payload map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode healthCheck response: %v", err)
+	}
+	if payload["status"] != "healthy" {
+		t.Fatalf("expected status healthy, got %q", payload["status"])
+	}
+}
+
+func TestLoginSucceedsAndRejectsBadCredentials(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t, ctx)
+
+	createRec := httptest.NewRecorder()
+	app.createUser(createRec, authedRequest(http.MethodPost, "/api/users",
+		`{"name":"Grace Hopper","email":"grace@example.com","age":40,"password":"s3cr3t!"}`, ""))
+	if createRec.Code != http.StatusCreated {
+		t.Fatalf("bootstrap createUser: expected 201, got %d (%s)", createRec.Code, createRec.Body.String())
+	}
+
+	token := loginAs(t, app, "grace@example.com", "s3cr3t!")
+	if token == "" {
+		t.Fatalf("expected a non-empty session token")
+	}
+
+	wrongPasswordRec := httptest.NewRecorder()
+	app.login(wrongPasswordRec, httptest.NewRequest(http.MethodPost, "/api/login",
+		strings.NewReader(`{"identifier":"grace@example.com","password":"wrong"}`)))
+	if wrongPasswordRec.Code != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password: expected 401, got %d", wrongPasswordRec.Code)
+	}
+
+	unknownUserRec := httptest.NewRecorder()
+	app.login(unknownUserRec, httptest.NewRequest(http.MethodPost, "/api/login",
+		strings.NewReader(`{"identifier":"nobody@example.com","password":"whatever"}`)))
+	if unknownUserRec.Code != http.StatusUnauthorized {
+		t.Fatalf("login with unknown identifier: expected 401, got %d", unknownUserRec.Code)
+	}
+}
+
+func TestGetUsersPagination(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t, ctx)
+
+	bootstrapRec := httptest.NewRecorder()
+	app.createUser(bootstrapRec, authedRequest(http.MethodPost, "/api/users",
+		`{"name":"User 0","email":"user0@example.com","age":20,"password":"pw"}`, ""))
+	if bootstrapRec.Code != http.StatusCreated {
+		t.Fatalf("bootstrap createUser: expected 201, got %d (%s)", bootstrapRec.Code, bootstrapRec.Body.String())
+	}
+	token := loginAs(t, app, "user0@example.com", "pw")
+
+	for i := 1; i < 3; i++ {
+		body := fmt.Sprintf(`{"name":"User %d","email":"user%d@example.com","age":20,"password":"pw"}`, i, i)
+		rec := httptest.NewRecorder()
+		app.createUser(rec, authedRequest(http.MethodPost, "/api/users", body, token))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("createUser %d: expected 201, got %d (%s)", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	pageRec := httptest.NewRecorder()
+	app.getUsers(pageRec, httptest.NewRequest(http.MethodGet, "/api/users?limit=1&skip=1", nil))
+	if pageRec.Code != http.StatusOK {
+		t.Fatalf("getUsers: expected 200, got %d", pageRec.Code)
+	}
+
+	var page []User
+	if err := json.NewDecoder(pageRec.Body).Decode(&page); err != nil {
+		t.Fatalf("decode getUsers response: %v", err)
+	}
+	if len(page) != 1 {
+		t.Fatalf("expected exactly one user with limit=1, got %d", len(page))
+	}
+}
+
+func TestRequireAuthRejectsMissingAndInvalidTokens(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t, ctx)
+
+	protected := app.sessionManager.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{"missing", ""},
+		{"malformed", "not-a-jwt"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			protected.ServeHTTP(rec, authedRequest(http.MethodGet, "/api/users/000000000000000000000000", "", tc.token))
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401 for %s token, got %d", tc.name, rec.Code)
+			}
+		})
+	}
+}
+
+func TestUpdateDeleteRejectForeignUser(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t, ctx)
+
+	bootstrapRec := httptest.NewRecorder()
+	app.createUser(bootstrapRec, authedRequest(http.MethodPost, "/api/users",
+		`{"name":"User A","email":"a@example.com","age":30,"password":"pw-a"}`, ""))
+	if bootstrapRec.Code != http.StatusCreated {
+		t.Fatalf("createUser A: expected 201, got %d (%s)", bootstrapRec.Code, bootstrapRec.Body.String())
+	}
+	var userA User
+	if err := json.NewDecoder(bootstrapRec.Body).Decode(&userA); err != nil {
+		t.Fatalf("decode createUser A response: %v", err)
+	}
+	tokenA := loginAs(t, app, "a@example.com", "pw-a")
+
+	bRec := httptest.NewRecorder()
+	app.createUser(bRec, authedRequest(http.MethodPost, "/api/users",
+		`{"name":"User B","email":"b@example.com","age":31,"password":"pw-b"}`, tokenA))
+	if bRec.Code != http.StatusCreated {
+		t.Fatalf("createUser B: expected 201, got %d (%s)", bRec.Code, bRec.Body.String())
+	}
+	tokenB := loginAs(t, app, "b@example.com", "pw-b")
+
+	protectedUpdate := app.sessionManager.RequireAuth(http.HandlerFunc(app.updateUser))
+	protectedDelete := app.sessionManager.RequireAuth(http.HandlerFunc(app.deleteUser))
+
+	updateReq := authedRequest(http.MethodPut, "/api/users/"+userA.ID.Hex(),
+		`{"name":"Hijacked","email":"a@example.com","age":99}`, tokenB)
+	updateReq = mux.SetURLVars(updateReq, map[string]string{"id": userA.ID.Hex()})
+	updateRec := httptest.NewRecorder()
+	protectedUpdate.ServeHTTP(updateRec, updateReq)
+	if updateRec.Code != http.StatusForbidden {
+		t.Fatalf("updateUser as foreign user: expected 403, got %d (%s)", updateRec.Code, updateRec.Body.String())
+	}
+
+	deleteReq := authedRequest(http.MethodDelete, "/api/users/"+userA.ID.Hex(), "", tokenB)
+	deleteReq = mux.SetURLVars(deleteReq, map[string]string{"id": userA.ID.Hex()})
+	deleteRec := httptest.NewRecorder()
+	protectedDelete.ServeHTTP(deleteRec, deleteReq)
+	if deleteRec.Code != http.StatusForbidden {
+		t.Fatalf("deleteUser as foreign user: expected 403, got %d (%s)", deleteRec.Code, deleteRec.Body.String())
+	}
+}
+
+func TestInstrumentedHandlerTagsRequestAndExportsMetrics(t *testing.T) {
+	ctx := context.Background()
+	app := newTestApp(t, ctx)
+
+	handler := withRequestID(instrumentHandler("health_check", app.healthCheck))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("health_check: expected 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("expected withRequestID to set X-Request-ID on the response")
+	}
+
+	metricsRec := httptest.NewRecorder()
+	metricsHandler().ServeHTTP(metricsRec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if metricsRec.Code != http.StatusOK {
+		t.Fatalf("metricsHandler: expected 200, got %d", metricsRec.Code)
+	}
+	if !strings.Contains(metricsRec.Body.String(), `handler="health_check"`) {
+		t.Fatalf("expected /metrics to include a counter for health_check, got:\n%s", metricsRec.Body.String())
+	}
+}
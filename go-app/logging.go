@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// initLogger points the default slog logger at a JSON handler, so every
+// log line (ours and the stdlib log.* calls other packages may still
+// emit) comes out machine-parseable.
+func initLogger() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+}
+
+type requestIDKey struct{}
+
+// withRequestID assigns each request an ID (reusing the caller's
+// X-Request-ID if present), stores it on the context, and echoes it back
+// on the response so it can be correlated with client-side logs too.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID := r.Header.Get("X-Request-ID")
+		if reqID == "" {
+			reqID = primitive.NewObjectID().Hex()
+		}
+		w.Header().Set("X-Request-ID", reqID)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, reqID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// loggerFromContext returns a logger pre-tagged with the request's ID,
+// so handlers don't have to thread it through manually.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	return slog.Default().With("request_id", requestIDFromContext(ctx))
+}
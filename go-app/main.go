@@ -1,163 +1,246 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type User struct {
-	ID    primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Name  string             `bson:"name" json:"name"`
-	Email string             `bson:"email" json:"email"`
-	Age   int                `bson:"age" json:"age"`
-}
+// defaultSecretsPath is where the Vault agent injects rendered MongoDB
+// credentials inside the pod.
+const defaultSecretsPath = "/vault/secrets/mongo"
+
+// mongoHost is the in-cluster MongoDB endpoint exposed by the Helm chart.
+const mongoHost = "mongodb.mongo-vault-operator.svc.cluster.local:27017"
 
 type App struct {
+	mu     sync.RWMutex
 	client *mongo.Client
 	db     *mongo.Database
-}
 
-func NewApp() *App {
-	return &App{}
+	cfg            Config
+	credSource     CredentialSource
+	watcher        *SecretsWatcher
+	lastCreds      Credentials
+	sessionManager *SessionManager
 }
 
-func readVaultSecrets() (string, string, error) {
-	// Try to read from Vault injected file first
-	secretsFile := "/vault/secrets/mongo"
-	if file, err := os.Open(secretsFile); err == nil {
-		defer file.Close()
-		
-		var mongoUser, mongoPassword string
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if strings.HasPrefix(line, "export MONGO_USER=") {
-				mongoUser = strings.Trim(strings.TrimPrefix(line, "export MONGO_USER="), `"`)
-			} else if strings.HasPrefix(line, "export MONGO_PASSWORD=") {
-				mongoPassword = strings.Trim(strings.TrimPrefix(line, "export MONGO_PASSWORD="), `"`)
-			}
-		}
-		
-		if mongoUser != "" && mongoPassword != "" {
-			return mongoUser, mongoPassword, nil
+// NewApp builds an App from cfg without connecting yet; callers must
+// call connectToMongoDB before serving traffic. Production (main) and
+// the integration test suite both go through this same constructor,
+// differing only in the Config they pass.
+func NewApp(cfg Config) *App {
+	var credSource CredentialSource
+	switch {
+	case cfg.AuthMode == AuthModeX509:
+		credSource = NewX509CredentialSource()
+	case cfg.CredentialSource == CredentialSourceEnv:
+		credSource = EnvCredentialSource{}
+	case cfg.CredentialSource == CredentialSourceVaultAPI:
+		credSource = VaultAPICredentialSource{
+			Addr:      cfg.VaultAddr,
+			MountPath: cfg.VaultDBMount,
+			RoleName:  cfg.VaultDBRole,
+			TokenPath: cfg.VaultK8sTokenPath,
 		}
+	default:
+		credSource = FileCredentialSource{Path: cfg.SecretsPath}
 	}
-	
-	// Fallback to environment variables
-	mongoUser := os.Getenv("MONGO_USER")
-	mongoPassword := os.Getenv("MONGO_PASSWORD")
-	
-	if mongoUser == "" || mongoPassword == "" {
-		return "", "", fmt.Errorf("MongoDB credentials not found in Vault secrets file or environment variables")
+
+	return &App{
+		cfg:        cfg,
+		credSource: credSource,
 	}
-	
-	return mongoUser, mongoPassword, nil
 }
 
-func (a *App) connectToMongoDB() error {
-	// Read MongoDB credentials from Vault injected files or environment variables
-	mongoUser, mongoPassword, err := readVaultSecrets()
-	if err != nil {
-		return err
+func logCredentials(creds Credentials) {
+	if creds.AuthMode == AuthModeX509 {
+		slog.Info("successfully read Vault-issued PKI client certificate for MONGODB-X509 auth")
+		return
 	}
+	slog.Info("successfully read credentials from Vault", "user", creds.User)
+}
 
-	log.Printf("Successfully read credentials from Vault - User: %s, Password: %s", mongoUser, "***hidden***")
-
-	// MongoDB connection string
-	mongoURI := fmt.Sprintf("mongodb://%s:%s@mongodb.mongo-vault-operator.svc.cluster.local:27017/appdb", mongoUser, mongoPassword)
-	
-	// Set client options
-	clientOptions := options.Client().ApplyURI(mongoURI)
+// newMongoClient dials MongoDB with the given credentials, returning the
+// connected client without touching App state. Callers swap it in under
+// the App's write lock so in-flight readers never observe a half-built
+// client.
+func (a *App) newMongoClient(creds Credentials) (*mongo.Client, error) {
+	clientOptions := options.Client().ApplyURI(a.cfg.mongoURI(creds)).SetPoolMonitor(newPoolMonitor())
+	if creds.AuthMode == AuthModeX509 {
+		clientOptions.SetTLSConfig(creds.TLSConfig)
+	}
 
-	// Connect to MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ConnectTimeout)
 	defer cancel()
 
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %v", err)
+		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+	}
+
+	pingCtx, pingCancel := context.WithTimeout(context.Background(), a.cfg.PingTimeout)
+	defer pingCancel()
+	if err := client.Ping(pingCtx, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %v", err)
 	}
 
-	// Check the connection
-	err = client.Ping(ctx, nil)
+	return client, nil
+}
+
+func (a *App) connectToMongoDB() error {
+	creds, err := a.credSource.Read()
 	if err != nil {
-		return fmt.Errorf("failed to ping MongoDB: %v", err)
+		return err
 	}
 
+	logCredentials(creds)
+
+	client, err := a.newMongoClient(creds)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
 	a.client = client
-	a.db = client.Database("appdb")
-	
-	log.Println("Connected to MongoDB successfully!")
+	a.db = client.Database(a.cfg.DBName)
+	a.lastCreds = creds
+	a.mu.Unlock()
+
+	a.applySigningKey(creds)
+
+	slog.Info("connected to MongoDB successfully")
 	return nil
 }
 
-func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// applySigningKey pushes a freshly-read JWT signing key into the
+// SessionManager, if one is wired up and the secrets file carried a key.
+// X.509 and Vault API credentials never carry one, so rotation under
+// those sources leaves the signing key as whatever resolveSigningKey
+// picked at startup.
+func (a *App) applySigningKey(creds Credentials) {
+	if a.sessionManager != nil && creds.SigningKey != "" {
+		a.sessionManager.SetSigningKey([]byte(creds.SigningKey))
+	}
+}
 
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
-		return
+// resolveSigningKey picks the JWT signing key to start the
+// SessionManager with: the key bundled alongside Mongo credentials, if
+// the CredentialSource supplied one, otherwise the statically configured
+// JWT_SIGNING_KEY, which is the only option for the X.509 and Vault API
+// sources.
+func (a *App) resolveSigningKey(creds Credentials) []byte {
+	if creds.SigningKey != "" {
+		return []byte(creds.SigningKey)
 	}
+	return []byte(a.cfg.JWTSigningKey)
+}
 
-	// Insert user into MongoDB
-	collection := a.db.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// rotateCredentials re-reads credentials from the App's CredentialSource
+// and, if they changed, dials a new Mongo client and atomically swaps it
+// in. The previous client is drained for a grace period before being
+// disconnected so requests already in flight against it can complete.
+func (a *App) rotateCredentials() error {
+	creds, err := a.credSource.Read()
+	if err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	unchanged := creds.Fingerprint == a.lastCreds.Fingerprint
+	a.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
 
-	result, err := collection.InsertOne(ctx, user)
+	client, err := a.newMongoClient(creds)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user"})
-		return
+		return err
 	}
 
-	user.ID = result.InsertedID.(primitive.ObjectID)
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	a.mu.Lock()
+	oldClient := a.client
+	oldCreds := a.lastCreds
+	a.client = client
+	a.db = client.Database(a.cfg.DBName)
+	a.lastCreds = creds
+	a.mu.Unlock()
+
+	a.applySigningKey(creds)
+
+	slog.Info("rotated MongoDB client with refreshed Vault credentials")
+
+	if oldClient != nil {
+		go drainOldClient(oldClient)
+	}
+	if vaultSource, ok := a.credSource.(VaultAPICredentialSource); ok && oldCreds.LeaseID != "" {
+		go revokeOldLease(vaultSource, oldCreds.LeaseID)
+	}
+	return nil
 }
 
-func (a *App) getUsers(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// leaseRenewalDelay returns how long SecretsWatcher.leaseLoop should
+// wait before proactively rotating a Vault API-sourced dynamic
+// credential: most of the current lease's own TTL, rather than a fixed
+// interval unrelated to how long the lease is actually valid for.
+func (a *App) leaseRenewalDelay() time.Duration {
+	a.mu.RLock()
+	ttl := a.lastCreds.LeaseDuration
+	a.mu.RUnlock()
+	if ttl <= 0 {
+		return pollFallbackInterval
+	}
+	return ttl * 4 / 5
+}
 
-	collection := a.db.Collection("users")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// drainOldClient disconnects a superseded Mongo client after letting any
+// in-flight requests against it finish.
+func drainOldClient(client *mongo.Client) {
+	time.Sleep(drainGrace)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		slog.Error("error disconnecting drained MongoDB client", "error", err)
+	}
+}
 
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch users"})
-		return
+// revokeOldLease revokes a superseded Vault dynamic credential lease
+// after letting any in-flight requests against its Mongo client finish,
+// mirroring drainOldClient's grace period.
+func revokeOldLease(source VaultAPICredentialSource, leaseID string) {
+	time.Sleep(drainGrace)
+	if err := source.Revoke(leaseID); err != nil {
+		slog.Error("failed to revoke superseded Vault lease", "lease_id", leaseID, "error", err)
 	}
-	defer cursor.Close(ctx)
+}
 
-	var users []User
-	if err = cursor.All(ctx, &users); err != nil {
+// handle returns the currently active client/db pair under the read
+// lock, so handlers always see a consistent pair even mid-rotation.
+func (a *App) handle() (*mongo.Client, *mongo.Database) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.client, a.db
+}
+
+func (a *App) rotateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := a.rotateCredentials(); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to decode users"})
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("rotation failed: %v", err)})
 		return
 	}
 
-	if users == nil {
-		users = []User{}
-	}
-
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(map[string]string{"status": "rotated"})
 }
 
 func (a *App) healthCheck(w http.ResponseWriter, r *http.Request) {
@@ -171,7 +254,9 @@ func (a *App) healthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	app := NewApp()
+	initLogger()
+
+	app := NewApp(DefaultConfig())
 
 	// Connect to MongoDB with retry logic
 	var err error
@@ -180,21 +265,57 @@ func main() {
 		if err == nil {
 			break
 		}
-		log.Printf("Failed to connect to MongoDB (attempt %d/10): %v", i+1, err)
+		slog.Warn("failed to connect to MongoDB", "attempt", i+1, "max_attempts", 10, "error", err)
 		time.Sleep(10 * time.Second)
 	}
 
 	if err != nil {
-		log.Fatalf("Could not connect to MongoDB after 10 attempts: %v", err)
+		slog.Error("could not connect to MongoDB after 10 attempts", "error", err)
+		os.Exit(1)
 	}
 
+	if err := app.ensureIndexes(); err != nil {
+		slog.Error("could not ensure MongoDB indexes", "error", err)
+		os.Exit(1)
+	}
+
+	signingKey := app.resolveSigningKey(app.lastCreds)
+	if len(signingKey) == 0 {
+		slog.Error("no JWT signing key available: set JWT_SIGNING_KEY, or have the Vault agent render export JWT_SIGNING_KEY=... into the secrets file for file/env credential sources")
+		os.Exit(1)
+	}
+
+	app.sessionManager = NewSessionManager(app, signingKey)
+	if err := app.sessionManager.ensureIndexes(); err != nil {
+		slog.Error("could not ensure session indexes", "error", err)
+		os.Exit(1)
+	}
+
+	// Watch the Vault-injected credential file(s) so lease renewals and
+	// PKI cert reissues are picked up without a restart. Which paths
+	// depends on auth mode: the password secrets file, or the X.509
+	// CA/cert/key trio.
+	app.watcher = NewSecretsWatcher(app, secretsWatchPaths(app.cfg)...)
+	app.watcher.Start()
+
 	// Setup routes
 	r := mux.NewRouter()
-	
+	r.Use(withRequestID)
+
 	// API routes
-	r.HandleFunc("/api/users", app.createUser).Methods("POST")
-	r.HandleFunc("/api/users", app.getUsers).Methods("GET")
-	r.HandleFunc("/health", app.healthCheck).Methods("GET")
+	// createUser (registration) checks auth itself rather than being
+	// wrapped in RequireAuth: it's public only for the very first user,
+	// when there's no session yet to bootstrap one with, and requires a
+	// valid session like any other mutation route once one exists.
+	r.Handle("/api/users", instrumentHandler("create_user", app.createUser)).Methods("POST")
+	r.Handle("/api/users", instrumentHandler("get_users", app.getUsers)).Methods("GET")
+	r.Handle("/api/users/{id}", instrumentHandler("get_user", app.getUser)).Methods("GET")
+	r.Handle("/api/users/{id}", instrumentHandler("update_user", app.sessionManager.RequireAuth(http.HandlerFunc(app.updateUser)).ServeHTTP)).Methods("PUT")
+	r.Handle("/api/users/{id}", instrumentHandler("delete_user", app.sessionManager.RequireAuth(http.HandlerFunc(app.deleteUser)).ServeHTTP)).Methods("DELETE")
+	r.Handle("/api/login", instrumentHandler("login", app.login)).Methods("POST")
+	r.Handle("/health", instrumentHandler("health_check", app.healthCheck)).Methods("GET")
+	r.Handle("/admin/rotate", instrumentHandler("rotate", app.sessionManager.RequireAuth(http.HandlerFunc(app.rotateHandler)).ServeHTTP)).Methods("POST")
+	r.Handle("/metrics", metricsHandler()).Methods("GET")
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -202,6 +323,9 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	slog.Info("server starting", "port", port)
+	if err := http.ListenAndServe(":"+port, r); err != nil {
+		slog.Error("server exited", "error", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pollFallbackInterval is how often the watcher re-checks the secrets file
+// when fsnotify can't be set up (e.g. the secrets path is on a filesystem
+// that doesn't support inotify, which happens with some CSI/projected
+// volume implementations).
+const pollFallbackInterval = 15 * time.Second
+
+// drainGrace is how long an old Mongo client is kept alive after a
+// rotation so in-flight requests started against it can finish before it
+// is disconnected.
+const drainGrace = 30 * time.Second
+
+// SecretsWatcher watches for MongoDB credential rotation and triggers a
+// reload on the App. Which strategy it uses depends on the App's
+// CredentialSource: file/env/X.509 sources have an agent-rendered file
+// to fsnotify (Vault's dynamic database secrets engine rewrites the
+// password file as leases are renewed/rotated; the PKI engine rewrites
+// the CA/cert/key files as short-lived certs are reissued), falling back
+// to polling if the watch can't be set up. VaultAPICredentialSource has
+// no file at all — it talks to Vault directly — so it's driven by
+// leaseLoop instead, which polls on the lease's own TTL rather than a
+// fixed interval.
+type SecretsWatcher struct {
+	app        *App
+	paths      []string
+	leaseBased bool
+	stopCh     chan struct{}
+}
+
+// NewSecretsWatcher builds a watcher for the given App. paths are the
+// file(s) to fsnotify/poll (see secretsWatchPaths) and are ignored when
+// app.cfg selects the Vault API credential source, which instead drives
+// leaseLoop off app.lastCreds.LeaseDuration.
+func NewSecretsWatcher(app *App, paths ...string) *SecretsWatcher {
+	return &SecretsWatcher{
+		app:        app,
+		paths:      paths,
+		leaseBased: app.cfg.AuthMode != AuthModeX509 && app.cfg.CredentialSource == CredentialSourceVaultAPI,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// secretsWatchPaths returns the credential file(s) the watcher should
+// follow for cfg's auth mode and credential source: the single rendered
+// password secrets file, the CA/cert/key trio the PKI engine rewrites on
+// reissue, or no paths at all for the Vault API credential source, which
+// has no agent-rendered file to watch.
+func secretsWatchPaths(cfg Config) []string {
+	if cfg.AuthMode == AuthModeX509 {
+		x509Source := NewX509CredentialSource()
+		return []string{x509Source.CAPath, x509Source.CertPath, x509Source.KeyPath}
+	}
+	if cfg.CredentialSource == CredentialSourceVaultAPI {
+		return nil
+	}
+	return []string{cfg.SecretsPath}
+}
+
+// Start runs the watch loop in the background. For file-backed
+// credential sources it prefers fsnotify and falls back to polling if
+// the watcher can't be created or the path can't be watched; for the
+// Vault API credential source it runs leaseLoop instead, since there is
+// no file to watch.
+func (w *SecretsWatcher) Start() {
+	if w.leaseBased {
+		go w.leaseLoop()
+		return
+	}
+	go w.run()
+}
+
+// Stop ends the watch loop.
+func (w *SecretsWatcher) Stop() {
+	close(w.stopCh)
+}
+
+func (w *SecretsWatcher) run() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Warn("fsnotify unavailable, falling back to polling", "error", err)
+		w.pollLoop()
+		return
+	}
+	defer watcher.Close()
+
+	for _, path := range w.paths {
+		if err := watcher.Add(path); err != nil {
+			slog.Warn("failed to watch secrets path, falling back to polling", "path", path, "error", err)
+			w.pollLoop()
+			return
+		}
+	}
+
+	slog.Info("watching secrets paths for credential rotation via fsnotify", "paths", w.paths)
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// Vault agent typically renders the secret by writing a new
+			// file and renaming it over the old one, which surfaces as a
+			// CREATE/WRITE/REMOVE depending on the filesystem.
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove) != 0 {
+				w.reload("fsnotify:" + event.Op.String())
+				// Re-add the watch in case the file was replaced rather
+				// than written in place (invalidates the old inode watch).
+				_ = watcher.Add(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("fsnotify error", "error", err)
+		}
+	}
+}
+
+func (w *SecretsWatcher) pollLoop() {
+	ticker := time.NewTicker(pollFallbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			w.reload("poll")
+		}
+	}
+}
+
+// leaseLoop drives rotation for the Vault API credential source: it
+// sleeps for most of the current lease's TTL, then rotates. Minting a
+// fresh dynamic credential on a fixed pollFallbackInterval regardless of
+// lease length — what the earlier file-watch fallback did when pointed
+// at a CredentialSource with no file — churns through Vault database
+// leases far faster than they actually expire, so this waits out the
+// lease instead.
+func (w *SecretsWatcher) leaseLoop() {
+	for {
+		timer := time.NewTimer(w.app.leaseRenewalDelay())
+		select {
+		case <-w.stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+			w.reload("lease-ttl")
+		}
+	}
+}
+
+// reload re-reads credentials and, if they changed, rebuilds the Mongo
+// client. Errors are logged rather than fatal since a transient read
+// failure (e.g. the agent is mid-write) shouldn't take the app down.
+func (w *SecretsWatcher) reload(trigger string) {
+	if err := w.app.rotateCredentials(); err != nil {
+		slog.Warn("credential reload failed", "trigger", trigger, "error", err)
+		return
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sessionsCollection is the name of the Mongo collection backing active
+// sessions. A TTL index on expires_at lets Mongo reap expired sessions
+// itself rather than relying on a sweep job.
+const sessionsCollection = "sessions"
+
+// sessionTTL is how long an issued JWT/session stays valid.
+const sessionTTL = 24 * time.Hour
+
+// session is the Mongo-side record of an issued JWT. The document's _id
+// is the JWT's "jti" claim, so validating a token is a single lookup by
+// _id rather than a collection scan.
+type session struct {
+	ID        string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// sessionClaims is the JWT payload issued on login.
+type sessionClaims struct {
+	UserID string `json:"uid"`
+	jwt.RegisteredClaims
+}
+
+// contextKey avoids collisions with context keys set by other packages.
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// SessionManager issues and validates JWT-backed sessions. It reads
+// MongoDB through the owning App so it always observes the currently
+// active client/db pair, even mid credential-rotation, and its signing
+// key is updated in lockstep with Vault-issued secrets via SetSigningKey.
+type SessionManager struct {
+	app *App
+
+	mu         sync.RWMutex
+	signingKey []byte
+}
+
+// NewSessionManager builds a SessionManager backed by app's Mongo
+// connection, using signingKey to sign and verify issued JWTs.
+func NewSessionManager(app *App, signingKey []byte) *SessionManager {
+	return &SessionManager{app: app, signingKey: signingKey}
+}
+
+// SetSigningKey swaps the active signing key, e.g. after the Vault agent
+// rewrites the secrets file with a freshly rotated key. Tokens signed
+// with the previous key remain valid for verification purposes only if
+// their session document hasn't expired; we don't re-verify past tokens
+// against old keys, so rotating the key effectively invalidates
+// outstanding sessions signed before it.
+func (sm *SessionManager) SetSigningKey(key []byte) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.signingKey = key
+}
+
+func (sm *SessionManager) key() []byte {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.signingKey
+}
+
+// ensureIndexes creates the TTL index sessions rely on to auto-expire.
+// ExpireAfterSeconds(0) means a document expires at the exact time
+// stored in expires_at, rather than N seconds after some fixed field.
+func (sm *SessionManager) ensureIndexes() error {
+	_, db := sm.app.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ttlIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, err := db.Collection(sessionsCollection).Indexes().CreateOne(ctx, ttlIndex)
+	return err
+}
+
+// Issue creates a new session for userID and returns the signed JWT.
+func (sm *SessionManager) Issue(userID primitive.ObjectID) (string, error) {
+	jti := primitive.NewObjectID().Hex()
+	expiresAt := time.Now().Add(sessionTTL)
+
+	claims := sessionClaims{
+		UserID: userID.Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(sm.key())
+	if err != nil {
+		return "", err
+	}
+
+	_, db := sm.app.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = db.Collection(sessionsCollection).InsertOne(ctx, session{
+		ID:        jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// authenticate validates the bearer token, confirms its session is
+// still live in Mongo, and loads the associated user.
+func (sm *SessionManager) authenticate(r *http.Request) (*User, error) {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return nil, jwt.ErrTokenMalformed
+	}
+	tokenString := strings.TrimPrefix(header, prefix)
+
+	var claims sessionClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return sm.key(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, db := sm.app.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var sess session
+	if err := db.Collection(sessionsCollection).FindOne(ctx, bson.M{"_id": claims.ID}).Decode(&sess); err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := db.Collection(usersCollection).FindOne(ctx, bson.M{"_id": sess.UserID}).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// RequireAuth wraps next so it only runs once the request carries a
+// valid Authorization: Bearer token backed by a live session; the
+// authenticated user is injected into the request context.
+func (sm *SessionManager) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := sm.authenticate(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Unauthorized"}`))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UserFromContext returns the authenticated user injected by RequireAuth.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userContextKey).(*User)
+	return user, ok
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// Default paths for the Vault PKI engine's short-lived client
+// certificate material, injected by the same agent sidecar that renders
+// /vault/secrets/mongo. Configurable via env so deployments can point at
+// whatever the PKI role template writes.
+const (
+	defaultMongoTLSCAPath   = "/vault/secrets/mongo-tls-ca"
+	defaultMongoTLSCertPath = "/vault/secrets/mongo-tls-cert"
+	defaultMongoTLSKeyPath  = "/vault/secrets/mongo-tls-key"
+)
+
+// X509CredentialSource builds a *tls.Config from a Vault PKI-issued CA
+// bundle, client certificate, and client key, for MONGODB-X509 auth.
+// Because Vault's PKI engine issues short-lived certs, the same
+// SecretsWatcher that reloads password rotations also reloads these
+// files and rebuilds the client.
+type X509CredentialSource struct {
+	CAPath   string
+	CertPath string
+	KeyPath  string
+}
+
+// NewX509CredentialSource builds a source using the configured paths,
+// falling back to the conventional Vault agent render paths.
+func NewX509CredentialSource() X509CredentialSource {
+	return X509CredentialSource{
+		CAPath:   envOr("MONGO_TLS_CA_PATH", defaultMongoTLSCAPath),
+		CertPath: envOr("MONGO_TLS_CERT_PATH", defaultMongoTLSCertPath),
+		KeyPath:  envOr("MONGO_TLS_KEY_PATH", defaultMongoTLSKeyPath),
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (x X509CredentialSource) Read() (Credentials, error) {
+	caBytes, err := os.ReadFile(x.CAPath)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("read mongo TLS CA bundle: %w", err)
+	}
+	certBytes, err := os.ReadFile(x.CertPath)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("read mongo TLS client cert: %w", err)
+	}
+	keyBytes, err := os.ReadFile(x.KeyPath)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("read mongo TLS client key: %w", err)
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caBytes) {
+		return Credentials{}, fmt.Errorf("no valid certificates found in %s", x.CAPath)
+	}
+
+	clientCert, err := tls.X509KeyPair(certBytes, keyBytes)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("parse mongo TLS client key pair: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:      caPool,
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	sum := sha256.Sum256(append(append(caBytes, certBytes...), keyBytes...))
+
+	return Credentials{
+		AuthMode:    AuthModeX509,
+		TLSConfig:   tlsConfig,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}, nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// usersCollection is the name of the Mongo collection backing the User
+// API across all handlers in this file.
+const usersCollection = "users"
+
+// bootstrapCollection holds a single sentinel document claimed by
+// whichever createUser request is allowed to create the first user
+// anonymously. Claiming it is an atomic InsertOne against bootstrapID's
+// unique _id, so of two concurrent anonymous requests racing before any
+// user exists, only one can win the claim.
+const bootstrapCollection = "bootstrap"
+const bootstrapID = "first-user"
+
+type User struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name         string             `bson:"name" json:"name"`
+	Email        string             `bson:"email" json:"email"`
+	Age          int                `bson:"age" json:"age"`
+	PasswordHash string             `bson:"password_hash,omitempty" json:"-"`
+}
+
+// createUserRequest is the wire shape for POST /api/users: same fields as
+// User plus the plaintext password, which is hashed before storage and
+// never echoed back.
+type createUserRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Age      int    `json:"age"`
+	Password string `json:"password"`
+}
+
+// ensureIndexes creates the indexes the User API relies on. It's called
+// once at startup after the Mongo connection is established, so a
+// duplicate email can never slip in between handler calls.
+func (a *App) ensureIndexes() error {
+	_, db := a.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	emailIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err := db.Collection(usersCollection).Indexes().CreateOne(ctx, emailIndex)
+	return err
+}
+
+// claimBootstrap atomically claims the right to create the first user
+// anonymously: InsertOne against bootstrapID's unique _id either
+// succeeds (this caller gets the exception) or fails with a duplicate
+// key error (someone already claimed it), so two concurrent callers
+// can't both win.
+func (a *App) claimBootstrap(ctx context.Context) (bool, error) {
+	_, db := a.handle()
+	_, err := db.Collection(bootstrapCollection).InsertOne(ctx, bson.M{"_id": bootstrapID})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *App) createUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to hash password"})
+		return
+	}
+
+	// createUser is a mutation route like any other and requires auth,
+	// except for bootstrapping the very first user, when there's no
+	// session yet to create one with. That exception is granted by
+	// claimBootstrap's atomic claim rather than a plain user count, so
+	// it still holds under concurrent anonymous requests.
+	if _, err := a.sessionManager.authenticate(r); err != nil {
+		claimCtx, claimCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		claimed, claimErr := a.claimBootstrap(claimCtx)
+		claimCancel()
+		if claimErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to check bootstrap state"})
+			return
+		}
+		if !claimed {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unauthorized"})
+			return
+		}
+	}
+
+	user := User{
+		Name:         req.Name,
+		Email:        req.Email,
+		Age:          req.Age,
+		PasswordHash: string(passwordHash),
+	}
+
+	_, db := a.handle()
+	collection := db.Collection(usersCollection)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := collection.InsertOne(ctx, user)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Email already in use"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user"})
+		return
+	}
+
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (a *App) getUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	_, db := a.handle()
+	collection := db.Collection(usersCollection)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	findOptions := options.Find()
+	if limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil {
+		findOptions.SetLimit(limit)
+	}
+	if skip, err := strconv.ParseInt(r.URL.Query().Get("skip"), 10, 64); err == nil {
+		findOptions.SetSkip(skip)
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{}, findOptions)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch users"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var users []User
+	if err = cursor.All(ctx, &users); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to decode users"})
+		return
+	}
+
+	if users == nil {
+		users = []User{}
+	}
+
+	json.NewEncoder(w).Encode(users)
+}
+
+func (a *App) getUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user id"})
+		return
+	}
+
+	_, db := a.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user User
+	err = db.Collection(usersCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch user"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(user)
+}
+
+// updateUserRequest covers the fields PUT /api/users/{id} is allowed to
+// change. Password changes go through a dedicated flow, not this one.
+type updateUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Age   int    `json:"age"`
+}
+
+func (a *App) updateUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user id"})
+		return
+	}
+
+	if user, ok := UserFromContext(r.Context()); !ok || user.ID != id {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot modify another user's account"})
+		return
+	}
+
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	_, db := a.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"name": req.Name, "email": req.Email, "age": req.Age}}
+	result, err := db.Collection(usersCollection).UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Email already in use"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to update user"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(User{ID: id, Name: req.Name, Email: req.Email, Age: req.Age})
+}
+
+func (a *App) deleteUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid user id"})
+		return
+	}
+
+	if user, ok := UserFromContext(r.Context()); !ok || user.ID != id {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot delete another user's account"})
+		return
+	}
+
+	_, db := a.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := db.Collection(usersCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete user"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+// loginRequest matches Identifier against either the user's Name or
+// Email, mirroring how the rest of the demo app treats either as a
+// valid handle for a user.
+type loginRequest struct {
+	Identifier string `json:"identifier"`
+	Password   string `json:"password"`
+}
+
+func (a *App) login(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	_, db := a.handle()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{
+		{"name": req.Identifier},
+		{"email": req.Identifier},
+	}}
+
+	var user User
+	err := db.Collection(usersCollection).FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to look up user"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid credentials"})
+		return
+	}
+
+	token, err := a.sessionManager.Issue(user.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to issue session"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}